@@ -0,0 +1,61 @@
+package powerdns
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinel errors an APIError can wrap, so callers can use errors.Is without
+// caring about the exact HTTP status/body behind it.
+var (
+	// ErrZoneNotFound is wrapped by every APIError with a 404 status; for a
+	// zone-scoped request such as GetZone it means the zone doesn't exist.
+	ErrZoneNotFound = errors.New("zone not found")
+	// ErrUnauthorized means the API rejected the request's credentials (401/403).
+	ErrUnauthorized = errors.New("unauthorized")
+)
+
+// pdnsErrorBody is the JSON error shape PowerDNS returns on failure, e.g.
+// {"error": "Could not find domain 'example.com.'"}.
+type pdnsErrorBody struct {
+	Error string `json:"error"`
+}
+
+// APIError wraps a failed PowerDNS API response. It keeps the status code
+// and raw body around (Error() surfaces PowerDNS's own message when the
+// body parses as JSON) while still unwrapping to one of the sentinels above
+// for well-known conditions.
+type APIError struct {
+	Op         string
+	StatusCode int
+	Body       string
+	sentinel   error
+}
+
+func (e *APIError) Error() string {
+	msg := e.Body
+	var parsed pdnsErrorBody
+	if json.Unmarshal([]byte(e.Body), &parsed) == nil && parsed.Error != "" {
+		msg = parsed.Error
+	}
+	return fmt.Sprintf("%s: %s (HTTP %d)", e.Op, msg, e.StatusCode)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.sentinel
+}
+
+// newAPIError builds an APIError for a failed response, classifying
+// well-known status codes against the sentinel errors above.
+func newAPIError(op string, statusCode int, body []byte) *APIError {
+	apiErr := &APIError{Op: op, StatusCode: statusCode, Body: string(body)}
+	switch statusCode {
+	case http.StatusNotFound:
+		apiErr.sentinel = ErrZoneNotFound
+	case http.StatusUnauthorized, http.StatusForbidden:
+		apiErr.sentinel = ErrUnauthorized
+	}
+	return apiErr
+}
@@ -0,0 +1,141 @@
+package powerdns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/StackExchange/dnscontrol/v2/models"
+)
+
+// Metadata keys read from DomainConfig.Metadata. dnsconfig.js sets these via
+// the POWERDNS_METADATA(...) modifier in pkg/js/helpers.js; print-ir/check
+// need no extra code to surface them since PrintJSON already marshals the
+// full DomainConfig, Metadata included.
+const (
+	metaDnsSec     = "dnssec"
+	metaNsec3Param = "nsec3param"
+	metaSoaEdit    = "soa_edit"
+	metaSoaEditApi = "soa_edit_api"
+	metaApiRectify = "api_rectify"
+	metaAccount    = "account"
+	// metaKind is read only when creating a not-yet-existing zone; PowerDNS
+	// doesn't allow changing a zone's kind afterwards, so it's excluded from
+	// metadataKeys/metadataCorrection below.
+	metaKind = "kind"
+)
+
+var metadataKeys = []string{metaDnsSec, metaNsec3Param, metaSoaEdit, metaSoaEditApi, metaApiRectify, metaAccount}
+
+// hasMetadata reports whether dc.Metadata carries any of the PowerDNS-specific
+// zone metadata keys above.
+func hasMetadata(dc *models.DomainConfig) bool {
+	for _, k := range metadataKeys {
+		if _, ok := dc.Metadata[k]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataUpdate diffs dc's requested zone-level metadata against zone and
+// returns the PdnsZone to PUT, the human-readable list of changes (empty if
+// none), and whether DNSSEC is being newly enabled. It errors out (rather
+// than silently skipping the field) if api_rectify/dnssec aren't valid
+// booleans, so a typo doesn't quietly no-op.
+func metadataUpdate(dc *models.DomainConfig, zone *PdnsZone) (PdnsZone, []string, bool, error) {
+	var changes []string
+	update := *zone
+	update.RRsets = nil // this is a zone-metadata PUT, not an rrset PATCH
+	enablingDnsSec := false
+
+	if v, ok := dc.Metadata[metaSoaEdit]; ok && v != zone.SoaEdit {
+		changes = append(changes, fmt.Sprintf("SOA-EDIT: %q -> %q", zone.SoaEdit, v))
+		update.SoaEdit = v
+	}
+	if v, ok := dc.Metadata[metaSoaEditApi]; ok && v != zone.SoaEditApi {
+		changes = append(changes, fmt.Sprintf("SOA-EDIT-API: %q -> %q", zone.SoaEditApi, v))
+		update.SoaEditApi = v
+	}
+	if v, ok := dc.Metadata[metaAccount]; ok && v != zone.Account {
+		changes = append(changes, fmt.Sprintf("account: %q -> %q", zone.Account, v))
+		update.Account = v
+	}
+	if v, ok := dc.Metadata[metaNsec3Param]; ok && v != zone.Nsec3param {
+		changes = append(changes, fmt.Sprintf("NSEC3PARAM: %q -> %q", zone.Nsec3param, v))
+		update.Nsec3param = v
+	}
+	if s, ok := dc.Metadata[metaApiRectify]; ok {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return PdnsZone{}, nil, false, fmt.Errorf("PowerDNS Provider: %s metadata %q for %s: %w", metaApiRectify, s, dc.Name, err)
+		}
+		if v != zone.ApiRectify {
+			changes = append(changes, fmt.Sprintf("API-RECTIFY: %t -> %t", zone.ApiRectify, v))
+			update.ApiRectify = v
+		}
+	}
+	if s, ok := dc.Metadata[metaDnsSec]; ok {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return PdnsZone{}, nil, false, fmt.Errorf("PowerDNS Provider: %s metadata %q for %s: %w", metaDnsSec, s, dc.Name, err)
+		}
+		if v != zone.DnsSec {
+			changes = append(changes, fmt.Sprintf("DNSSEC: %t -> %t", zone.DnsSec, v))
+			update.DnsSec = v
+			enablingDnsSec = v
+		}
+	}
+
+	return update, changes, enablingDnsSec, nil
+}
+
+// metadataCorrection compares the zone-level metadata requested in
+// dnsconfig.js against the zone PowerDNS currently reports and, if anything
+// differs, returns a Correction that PUTs the updated zone object and, when
+// DNSSEC is being turned on, provisions a KSK and rectifies the zone.
+//
+// F() re-fetches the zone and recomputes the update from that fresh copy
+// instead of reusing the snapshot passed in here: GetDomainCorrections fetches
+// the zone once and may also run a TSIG correction against that same
+// snapshot, and corrections run sequentially, so building the PUT body from
+// the stale snapshot would silently revert whichever correction ran first.
+func (p *PowerDNSProvider) metadataCorrection(dc *models.DomainConfig, zone *PdnsZone) (*models.Correction, error) {
+	if !hasMetadata(dc) {
+		return nil, nil
+	}
+
+	_, changes, _, err := metadataUpdate(dc, zone)
+	if err != nil {
+		return nil, err
+	}
+	if len(changes) == 0 {
+		return nil, nil
+	}
+
+	return &models.Correction{
+		Msg: fmt.Sprintf("Update zone metadata for %s:\n  %s", dc.Name, strings.Join(changes, "\n  ")),
+		F: func() error {
+			current, err := p.apiClient.GetZone(dc.Name)
+			if err != nil {
+				return err
+			}
+			update, _, enablingDnsSec, err := metadataUpdate(dc, current)
+			if err != nil {
+				return err
+			}
+			if err := p.apiClient.UpdateZone(dc.Name, update); err != nil {
+				return err
+			}
+			if enablingDnsSec {
+				if err := p.apiClient.EnableDNSSEC(dc.Name); err != nil {
+					return err
+				}
+				if err := p.apiClient.RectifyZone(dc.Name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}, nil
+}
@@ -2,18 +2,38 @@ package powerdns
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
 	"github.com/StackExchange/dnscontrol/v2/models"
 	"github.com/StackExchange/dnscontrol/v2/providers"
 	"github.com/StackExchange/dnscontrol/v2/providers/diff"
 )
 
+// defaultZoneKind is the PowerDNS zone "kind" used for auto-created zones
+// when creds.json doesn't set defaultKind and DomainConfig.Metadata doesn't
+// set the "kind" key.
+const defaultZoneKind = "Native"
+
 func init() {
-	providers.RegisterDomainServiceProviderType("POWERDNS", newPowerDNSProvider)
+	providers.RegisterDomainServiceProviderType("POWERDNS", newPowerDNSProvider, providers.CanCreateZones)
 }
 
 type PowerDNSProvider struct {
-	apiClient PowerDnsApiClient
+	apiClient       PowerDnsApiClient
+	tsigKeys        []tsigKeyConfig
+	defaultZoneKind string
+}
+
+// providerMetadata is the shape of the optional JSON metadata object passed
+// to NewDnsProvider(...) in dnsconfig.js, used for settings that apply to the
+// provider as a whole rather than to a single domain.
+type providerMetadata struct {
+	TSIGKeys []tsigKeyConfig `json:"tsig_keys"`
 }
 
 func newPowerDNSProvider(m map[string]string, metadata json.RawMessage) (providers.DNSServiceProvider, error) {
@@ -21,19 +41,92 @@ func newPowerDNSProvider(m map[string]string, metadata json.RawMessage) (provide
 		return nil, fmt.Errorf("PowerDNS Provider: Api key and/or base url missing. You maybe forgot to setup creds.json?")
 	}
 
-	apiClient := NewPowerDnsApiClient(m["apikey"], m["baseurl"])
-	_, err := apiClient.GetZones()
+	cfg, err := clientConfigFromCreds(m)
 	if err != nil {
 		return nil, err
 	}
 
+	apiClient, err := NewPowerDnsApiClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	servers, err := apiClient.ListServers()
+	if err != nil {
+		return nil, err
+	}
+	if !hasServer(servers, apiClient.serverId) {
+		return nil, fmt.Errorf("PowerDNS Provider: server %q not found, available servers: %s", apiClient.serverId, serverIds(servers))
+	}
+
+	_, err = apiClient.GetZones()
+	if err != nil {
+		return nil, err
+	}
+
+	var pm providerMetadata
+	if len(metadata) > 0 {
+		if err := json.Unmarshal(metadata, &pm); err != nil {
+			return nil, fmt.Errorf("PowerDNS Provider: invalid provider metadata: %s", err)
+		}
+	}
+
+	zoneKind := m["defaultKind"]
+	if zoneKind == "" {
+		zoneKind = defaultZoneKind
+	}
+
 	provider := &PowerDNSProvider{
-		apiClient: apiClient,
+		apiClient:       apiClient,
+		tsigKeys:        pm.TSIGKeys,
+		defaultZoneKind: zoneKind,
 	}
 
 	return provider, nil
 }
 
+// clientConfigFromCreds translates the string-only creds.json map into a
+// ClientConfig, so HTTP tuning lives alongside apikey/baseurl instead of
+// requiring code changes.
+func clientConfigFromCreds(m map[string]string) (ClientConfig, error) {
+	cfg := ClientConfig{
+		ApiKey:             m["apikey"],
+		BaseUrl:            m["baseurl"],
+		ApiVersion:         m["apiVersion"],
+		ServerId:           m["serverId"],
+		InsecureSkipVerify: m["insecureSkipVerify"] == "true",
+		CaCertFile:         m["caCertFile"],
+		ServerName:         m["serverName"],
+	}
+
+	if m["httpTimeout"] != "" {
+		seconds, err := strconv.Atoi(m["httpTimeout"])
+		if err != nil {
+			return ClientConfig{}, fmt.Errorf("PowerDNS Provider: invalid httpTimeout %q: %w", m["httpTimeout"], err)
+		}
+		cfg.HTTPTimeout = time.Duration(seconds) * time.Second
+	}
+
+	return cfg, nil
+}
+
+func hasServer(servers []PdnsServer, id string) bool {
+	for _, s := range servers {
+		if s.Id == id {
+			return true
+		}
+	}
+	return false
+}
+
+func serverIds(servers []PdnsServer) string {
+	ids := make([]string, len(servers))
+	for i, s := range servers {
+		ids[i] = s.Id
+	}
+	return strings.Join(ids, ", ")
+}
+
 func (p *PowerDNSProvider) GetNameservers(domain string) ([]*models.Nameserver, error) {
 	zone, err := p.apiClient.GetZone(domain)
 	if err != nil {
@@ -61,74 +154,207 @@ func (p *PowerDNSProvider) GetDomainCorrections(dc *models.DomainConfig) ([]*mod
 
 	zone, err := p.apiClient.GetZone(dc.Name)
 	if err != nil {
+		if errors.Is(err, ErrZoneNotFound) {
+			return p.createZoneCorrection(dc), nil
+		}
 		return nil, err
 	}
+
+	return p.zoneCorrections(dc, zone)
+}
+
+// zoneCorrections diffs dc against an already-fetched zone and returns the
+// corrections needed to bring PowerDNS's RRsets, zone metadata, and TSIG
+// key assignments in line with it.
+func (p *PowerDNSProvider) zoneCorrections(dc *models.DomainConfig, zone *PdnsZone) ([]*models.Correction, error) {
 	currentRecords := p.nativeToDomainConfig(zone.RRsets, dc)
 	models.PostProcessRecords(currentRecords)
 
 	differ := diff.New(dc)
 	_, create, del, modify := differ.IncrementalDiff(currentRecords)
 
-	var corrections = []*models.Correction{}
+	var corrections []*models.Correction
 
-	for _, d := range del {
-	   c := p.buildCorrection(d, dc, "delete")
-	   corrections = append(corrections, c)
+	if len(create) > 0 || len(del) > 0 || len(modify) > 0 {
+		sets, msgs := p.buildRRSets(dc, create, del, modify)
+		corrections = append(corrections, &models.Correction{
+			Msg: strings.Join(msgs, "\n"),
+			F: func() error {
+				return p.apiClient.UpdateZoneRRSets(dc.Name, sets)
+			},
+		})
 	}
 
-	for _, m := range modify {
-		c := p.buildCorrection(m, dc, "modify")
-		corrections = append(corrections, c)
+	mc, err := p.metadataCorrection(dc, zone)
+	if err != nil {
+		return nil, err
+	}
+	if mc != nil {
+		corrections = append(corrections, mc)
 	}
 
-	for _, c := range create {
-		c := p.buildCorrection(c, dc, "create")
-		corrections = append(corrections, c)
+	tc, err := p.tsigCorrection(dc, zone)
+	if err != nil {
+		return nil, err
+	}
+	if tc != nil {
+		corrections = append(corrections, tc)
 	}
 
 	return corrections, nil
 }
 
-func (p *PowerDNSProvider) buildCorrection(c diff.Correlation, dc *models.DomainConfig, action string) *models.Correction{
-	if action == "create" || action == "modify" {
-		correction := models.Correction{
-			Msg: fmt.Sprintf("%s", c.String()),
+// createZoneCorrection returns the single Correction that bootstraps a zone
+// dnsconfig.js wants but PowerDNS doesn't have yet: it creates the zone,
+// then re-diffs against it (now empty of records) so every desired record
+// pushes in the same run, matching providers that can create zones on
+// first sync instead of failing.
+func (p *PowerDNSProvider) createZoneCorrection(dc *models.DomainConfig) []*models.Correction {
+	kind := p.zoneKind(dc)
+
+	return []*models.Correction{
+		{
+			Msg: fmt.Sprintf("Create zone %s (kind=%s)", dc.Name, kind),
 			F: func() error {
-				set := PdnsRRSet{}
-				sets := make([]PdnsRRSet, 1)
-				set.ChangeType = ChangeTypeReplace
-				set.Name = fmt.Sprintf("%s.",c.Desired.GetLabelFQDN())
-				set.Type = c.Desired.Type
-				set.Records = make([]PdnsRecord, 1)
-				set.Records[0] = PdnsRecord{
-					 Content: c.Desired.GetTargetField(),
-					 Disabled: false,
+				if _, err := p.apiClient.CreateZone(dc.Name, kind, nil); err != nil {
+					return err
 				}
-				set.TTL = int(c.Desired.TTL)
-				sets[0] = set
-				return p.apiClient.UpdateZoneRRSets(dc.Name, sets)
-			},
-		}
-		return &correction
-	} else {
-		correction := models.Correction{
-			Msg: fmt.Sprintf("%s", c.String()),
-			F: func() error {
-				set := PdnsRRSet{}
-				sets := make([]PdnsRRSet, 1)
-				set.ChangeType = ChangeTypeDelete
-				set.Name = fmt.Sprintf("%s.", c.Existing.GetLabelFQDN())
-				set.Type = c.Existing.Type
-				set.Records = make([]PdnsRecord, 1)
-				set.Records[0] = PdnsRecord{
-				 	Content: c.Existing.GetTargetField(),
+
+				zone, err := p.apiClient.GetZone(dc.Name)
+				if err != nil {
+					return err
 				}
-				sets[0] = set
-				return p.apiClient.UpdateZoneRRSets(dc.Name, sets)
+
+				corrections, err := p.zoneCorrections(dc, zone)
+				if err != nil {
+					return err
+				}
+				for _, c := range corrections {
+					if err := c.F(); err != nil {
+						return err
+					}
+				}
+				return nil
 			},
+		},
+	}
+}
+
+// zoneKind resolves the PowerDNS zone "kind" (Native/Master/Slave) to use
+// when auto-creating dc's zone: dc.Metadata["kind"] if set, else the
+// provider's defaultKind from creds.json.
+func (p *PowerDNSProvider) zoneKind(dc *models.DomainConfig) string {
+	if kind, ok := dc.Metadata[metaKind]; ok && kind != "" {
+		return kind
+	}
+	return p.defaultZoneKind
+}
+
+// rrsetKey identifies an RRset by its owner name and type, the granularity
+// PowerDNS REPLACE/DELETE changes operate on.
+type rrsetKey struct {
+	name  string
+	rType string
+}
+
+// buildRRSets groups the per-record create/delete/modify correlations into
+// the []PdnsRRSet PowerDNS expects for a single PATCH. Any label/type that
+// gains or keeps at least one record is sent as a REPLACE carrying every
+// desired record for that RRset (not just the changed ones), so a modify
+// that only adds a second A record doesn't drop the first. Label/types that
+// lose all their records are sent as a DELETE. Per-change messages are kept
+// for the diff report even though they now share one Correction.
+func (p *PowerDNSProvider) buildRRSets(dc *models.DomainConfig, create, del, modify []diff.Correlation) ([]PdnsRRSet, []string) {
+	var msgs []string
+	replaced := map[rrsetKey]bool{}
+
+	for _, d := range del {
+		msgs = append(msgs, d.String())
+	}
+	for _, m := range modify {
+		msgs = append(msgs, m.String())
+		replaced[rrsetKeyFor(m.Desired)] = true
+	}
+	for _, c := range create {
+		msgs = append(msgs, c.String())
+		replaced[rrsetKeyFor(c.Desired)] = true
+	}
+
+	deleted := map[rrsetKey]bool{}
+	for _, d := range del {
+		k := rrsetKeyFor(d.Existing)
+		if !replaced[k] {
+			deleted[k] = true
+		}
+	}
+
+	// IncrementalDiff only reports the records that actually changed, so a
+	// "deleted" name+type can still have other desired records that were
+	// never touched (e.g. one of two A records removed). Those must go out
+	// as a REPLACE carrying the survivors, not a DELETE that would drop them.
+	for k := range deleted {
+		if desiredRRsetHasRecords(dc, k) {
+			delete(deleted, k)
+			replaced[k] = true
 		}
-		return &correction
 	}
+
+	var sets []PdnsRRSet
+
+	for k := range deleted {
+		sets = append(sets, PdnsRRSet{
+			Name:       k.name,
+			Type:       k.rType,
+			ChangeType: ChangeTypeDelete,
+		})
+	}
+
+	for k := range replaced {
+		var ttl uint32
+		var records []PdnsRecord
+		for _, rc := range dc.Records {
+			if rc.Type != k.rType || rrsetFQDN(rc) != k.name {
+				continue
+			}
+			ttl = rc.TTL
+			records = append(records, PdnsRecord{Content: rc.GetTargetField()})
+		}
+		sets = append(sets, PdnsRRSet{
+			Name:       k.name,
+			Type:       k.rType,
+			ChangeType: ChangeTypeReplace,
+			TTL:        int(ttl),
+			Records:    records,
+		})
+	}
+
+	sort.Slice(sets, func(i, j int) bool {
+		if sets[i].Name != sets[j].Name {
+			return sets[i].Name < sets[j].Name
+		}
+		return sets[i].Type < sets[j].Type
+	})
+
+	return sets, msgs
+}
+
+func rrsetKeyFor(rc *models.RecordConfig) rrsetKey {
+	return rrsetKey{name: rrsetFQDN(rc), rType: rc.Type}
+}
+
+// desiredRRsetHasRecords reports whether dc.Records still wants at least
+// one record for the given name+type.
+func desiredRRsetHasRecords(dc *models.DomainConfig, k rrsetKey) bool {
+	for _, rc := range dc.Records {
+		if rc.Type == k.rType && rrsetFQDN(rc) == k.name {
+			return true
+		}
+	}
+	return false
+}
+
+func rrsetFQDN(rc *models.RecordConfig) string {
+	return fmt.Sprintf("%s.", rc.GetLabelFQDN())
 }
 
 func (p *PowerDNSProvider) nativeToDomainConfig(native []PdnsRRSet, dc *models.DomainConfig) []*models.RecordConfig {
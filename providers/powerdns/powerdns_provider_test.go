@@ -0,0 +1,69 @@
+package powerdns
+
+import (
+	"testing"
+
+	"github.com/StackExchange/dnscontrol/v2/models"
+	"github.com/StackExchange/dnscontrol/v2/providers/diff"
+)
+
+func newTestRecord(fqdn, rType, target string, ttl uint32) *models.RecordConfig {
+	rc := &models.RecordConfig{Type: rType, Target: target, TTL: ttl}
+	rc.SetLabelFromFQDN(fqdn, "example.com")
+	return rc
+}
+
+// TestBuildRRSetsPartialDelete covers the case IncrementalDiff produces when
+// only one record of a multi-record RRset is removed: the surviving record
+// never shows up in create/del/modify (it didn't change), so buildRRSets
+// must not mistake the lone "del" correlation for "this name+type has no
+// records left" and emit a DELETE that would drop the survivor too.
+func TestBuildRRSetsPartialDelete(t *testing.T) {
+	p := &PowerDNSProvider{}
+
+	survivor := newTestRecord("www.example.com.", "A", "2.2.2.2", 300)
+	removed := newTestRecord("www.example.com.", "A", "1.1.1.1", 300)
+
+	dc := &models.DomainConfig{
+		Name:    "example.com",
+		Records: []*models.RecordConfig{survivor},
+	}
+
+	del := []diff.Correlation{{Existing: removed}}
+
+	sets, _ := p.buildRRSets(dc, nil, del, nil)
+
+	if len(sets) != 1 {
+		t.Fatalf("expected 1 RRset, got %d: %+v", len(sets), sets)
+	}
+	if sets[0].ChangeType != ChangeTypeReplace {
+		t.Fatalf("expected REPLACE to preserve the surviving record, got %s", sets[0].ChangeType)
+	}
+	if len(sets[0].Records) != 1 || sets[0].Records[0].Content != "2.2.2.2" {
+		t.Fatalf("expected surviving record 2.2.2.2 to be carried in the REPLACE, got %+v", sets[0].Records)
+	}
+}
+
+// TestBuildRRSetsFullDelete covers the case where every record of a
+// name+type is gone: that must still come out as a DELETE.
+func TestBuildRRSetsFullDelete(t *testing.T) {
+	p := &PowerDNSProvider{}
+
+	removed := newTestRecord("www.example.com.", "A", "1.1.1.1", 300)
+
+	dc := &models.DomainConfig{
+		Name:    "example.com",
+		Records: nil,
+	}
+
+	del := []diff.Correlation{{Existing: removed}}
+
+	sets, _ := p.buildRRSets(dc, nil, del, nil)
+
+	if len(sets) != 1 {
+		t.Fatalf("expected 1 RRset, got %d: %+v", len(sets), sets)
+	}
+	if sets[0].ChangeType != ChangeTypeDelete {
+		t.Fatalf("expected DELETE when no records remain, got %s", sets[0].ChangeType)
+	}
+}
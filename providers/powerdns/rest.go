@@ -2,6 +2,8 @@ package powerdns
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -12,16 +14,41 @@ import (
 	"time"
 )
 
+// DefaultHTTPTimeout is used when ClientConfig.HTTPTimeout is zero.
+const DefaultHTTPTimeout = 20 * time.Second
+
 const DefaultServerId string = "localhost" /* https://doc.powerdns.com/authoritative/http-api/server.html */
 const (
 	ChangeTypeReplace = "REPLACE"
 	ChangeTypeDelete  = "DELETE"
 )
 
+// ApiVersionV0 marks PowerDNS servers older than 4.0 that expose their API
+// directly under the server root instead of under a versioned "/api/vX" prefix.
+const ApiVersionV0 = "v0"
+
+// apiVersionInfo mirrors the entries returned by PowerDNS's unauthenticated
+// "/api" discovery endpoint, e.g. [{"version": "1", "url": "/api/v1"}].
+type apiVersionInfo struct {
+	Version string `json:"version"`
+	Url     string `json:"url"`
+}
+
 type PowerDnsApiClient struct {
-	client  *http.Client
-	apiKey  string
-	baseUrl string
+	client     *http.Client
+	apiKey     string
+	baseUrl    string
+	apiVersion string
+	serverId   string
+}
+
+// PdnsServer mirrors the entries returned by "/servers".
+type PdnsServer struct {
+	Id         string `json:"id,omitempty"`
+	Type       string `json:"type,omitempty"`
+	DaemonType string `json:"daemon_type,omitempty"`
+	Version    string `json:"version,omitempty"`
+	Url        string `json:"url,omitempty"`
 }
 
 type PdnsComments struct {
@@ -74,22 +101,171 @@ type RRSetsUpdate struct {
 	RRSets []PdnsRRSet `json:"rrsets"`
 }
 
-func NewPowerDnsApiClient(apiKey, baseUrl string) PowerDnsApiClient {
-	return PowerDnsApiClient{
-		apiKey:  apiKey,
-		baseUrl: baseUrl,
+// PdnsCryptoKeyRequest is the body accepted by "POST /zones/{zone}/cryptokeys"
+// to provision a new DNSSEC key. It carries no key content, so PowerDNS
+// generates the key material itself.
+type PdnsCryptoKeyRequest struct {
+	KeyType string `json:"keytype"`
+	Active  bool   `json:"active"`
+}
+
+// PdnsTSIGKey mirrors the entries returned by "/servers/{id}/tsigkeys". Its
+// Id is the canonicalized Name, which is also what zones reference in
+// master_tsig_key_ids/slave_tsig_key_ids.
+type PdnsTSIGKey struct {
+	Id        string `json:"id,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Algorithm string `json:"algorithm,omitempty"`
+	Key       string `json:"key,omitempty"`
+}
+
+// ClientConfig holds everything needed to build a PowerDnsApiClient. Zero
+// values are sane defaults: a 20s timeout, system CA verification,
+// DefaultServerId, and an auto-detected API version.
+type ClientConfig struct {
+	ApiKey     string
+	BaseUrl    string
+	ApiVersion string
+	ServerId   string
+
+	// HTTPTimeout overrides DefaultHTTPTimeout when non-zero.
+	HTTPTimeout time.Duration
+	// InsecureSkipVerify disables TLS certificate verification. Only use
+	// against a PowerDNS instance you trust on the network path.
+	InsecureSkipVerify bool
+	// CaCertFile, if set, is a PEM file of CA certificates trusted in
+	// addition to the system pool, for PowerDNS instances behind a
+	// corporate/private PKI.
+	CaCertFile string
+	// ServerName overrides the TLS ServerName (SNI) sent to the server,
+	// for when BaseUrl's host doesn't match the certificate's name.
+	ServerName string
+}
+
+// NewPowerDnsApiClient builds a client for the PowerDNS HTTP API. If
+// cfg.ApiVersion is empty, the client probes "<baseUrl>/api" to discover
+// which API version the server speaks, falling back to ApiVersionV0 when the
+// server predates that endpoint (non-JSON response or 404). If cfg.ServerId
+// is empty, DefaultServerId is used.
+func NewPowerDnsApiClient(cfg ClientConfig) (PowerDnsApiClient, error) {
+	serverId := cfg.ServerId
+	if serverId == "" {
+		serverId = DefaultServerId
+	}
+
+	timeout := cfg.HTTPTimeout
+	if timeout == 0 {
+		timeout = DefaultHTTPTimeout
+	}
+
+	transport, err := buildTransport(cfg)
+	if err != nil {
+		return PowerDnsApiClient{}, err
+	}
+
+	c := PowerDnsApiClient{
+		apiKey:   cfg.ApiKey,
+		baseUrl:  cfg.BaseUrl,
+		serverId: serverId,
 		client: &http.Client{
-			Timeout: time.Second * 20,
+			Timeout: timeout,
 		},
 	}
+	// Only set Transport when non-nil: a nil *http.Transport stored in the
+	// RoundTripper interface would not fall back to http.DefaultTransport.
+	if transport != nil {
+		c.client.Transport = transport
+	}
+
+	if cfg.ApiVersion != "" {
+		c.apiVersion = cfg.ApiVersion
+	} else {
+		c.apiVersion = c.detectApiVersion()
+	}
+
+	return c, nil
+}
+
+// buildTransport returns nil (http.DefaultTransport) unless the config asks
+// for TLS behavior that needs customizing.
+func buildTransport(cfg ClientConfig) (*http.Transport, error) {
+	if !cfg.InsecureSkipVerify && cfg.CaCertFile == "" && cfg.ServerName == "" {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		ServerName:         cfg.ServerName,
+	}
+
+	if cfg.CaCertFile != "" {
+		pemBytes, err := ioutil.ReadFile(cfg.CaCertFile)
+		if err != nil {
+			return nil, fmt.Errorf("PowerDNS Provider: reading caCertFile: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pemBytes) {
+			return nil, fmt.Errorf("PowerDNS Provider: no certificates found in caCertFile %q", cfg.CaCertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	return &http.Transport{TLSClientConfig: tlsConfig}, nil
 }
 
-func (c *PowerDnsApiClient) getApiUrl() (*url.URL, error) {
+// detectApiVersion probes the unauthenticated "/api" discovery endpoint and
+// returns the most recent version it advertises, or ApiVersionV0 if the
+// endpoint doesn't exist or doesn't return the expected JSON list.
+func (c *PowerDnsApiClient) detectApiVersion() string {
+	u, err := url.Parse(c.baseUrl)
+	if err != nil {
+		return ApiVersionV0
+	}
+	u.Path = path.Join(u.Path, "api")
+
+	req, err := c.createRequest("GET", u.String(), nil)
+	if err != nil {
+		return ApiVersionV0
+	}
+
+	response, err := c.client.Do(req)
+	if err != nil {
+		return ApiVersionV0
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return ApiVersionV0
+	}
+
+	responseBytes, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return ApiVersionV0
+	}
+
+	var versions []apiVersionInfo
+	if err := json.Unmarshal(responseBytes, &versions); err != nil || len(versions) == 0 {
+		return ApiVersionV0
+	}
+
+	// PowerDNS lists versions oldest-first, so the last entry is the newest.
+	newest := versions[len(versions)-1].Version
+	if newest == "" || newest == "0" {
+		return ApiVersionV0
+	}
+	return "v" + newest
+}
+
+// apiUrl builds the base URL for the API, taking into account whether the
+// server uses the versioned "/api/vX" prefix or the un-prefixed v0 layout.
+func (c *PowerDnsApiClient) apiUrl() (*url.URL, error) {
 	u, err := url.Parse(c.baseUrl)
 	if err != nil {
 		return nil, err
 	}
-	u.Path = path.Join(u.Path, "api/v1")
+	if c.apiVersion != ApiVersionV0 {
+		u.Path = path.Join(u.Path, "api", c.apiVersion)
+	}
 	return u, nil
 }
 
@@ -104,149 +280,414 @@ func (c *PowerDnsApiClient) createRequest(method, url string, body io.Reader) (*
 	return req, nil
 }
 
-func (c *PowerDnsApiClient) GetZones() (*[]PdnsZone, error) {
-	reqUrl, err := c.getApiUrl()
+// do executes req and reads the full response body, so callers can both
+// inspect the status code and build an APIError carrying PowerDNS's own
+// error message without a second round-trip.
+func (c *PowerDnsApiClient) do(req *http.Request) (*http.Response, []byte, error) {
+	response, err := c.client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return response, nil, err
+	}
+
+	return response, body, nil
+}
+
+// expectStatus returns an *APIError (wrapping ErrZoneNotFound/ErrUnauthorized
+// where applicable) unless response's status code is one of want.
+func expectStatus(op string, response *http.Response, body []byte, want ...int) error {
+	for _, code := range want {
+		if response.StatusCode == code {
+			return nil
+		}
+	}
+	return newAPIError(op, response.StatusCode, body)
+}
+
+// ListServers queries "/servers", the list of virtual servers this PowerDNS
+// instance exposes. It's used to validate a configured serverId up front.
+func (c *PowerDnsApiClient) ListServers() ([]PdnsServer, error) {
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return nil, err
 	}
-	reqUrl.Path = path.Join(reqUrl.Path, "/servers","/", DefaultServerId, "/zones")
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers")
 
 	req, err := c.createRequest("GET", reqUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := c.client.Do(req)
+	response, body, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	if err := expectStatus("list servers", response, body, http.StatusOK); err != nil {
+		return nil, err
+	}
 
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get DNS zones: %s", response.Status)
+	var servers []PdnsServer
+	if err := json.Unmarshal(body, &servers); err != nil {
+		return nil, err
 	}
 
-	responseBytes, err := ioutil.ReadAll(response.Body)
+	return servers, nil
+}
+
+func (c *PowerDnsApiClient) GetZones() (*[]PdnsZone, error) {
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return nil, err
 	}
-	zones := new([]PdnsZone)
-	err = json.Unmarshal(responseBytes, &zones)
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers","/", c.serverId, "/zones")
+
+	req, err := c.createRequest("GET", reqUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
+	response, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectStatus("get zones", response, body, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	zones := new([]PdnsZone)
+	if err := json.Unmarshal(body, zones); err != nil {
+		return nil, err
+	}
+
 	return zones, nil
 }
 
 func (c *PowerDnsApiClient) GetZone(zoneId string) (*PdnsZone, error) {
-	reqUrl, err := c.getApiUrl()
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return nil, err
 	}
-	reqUrl.Path = path.Join(reqUrl.Path, "/servers","/", DefaultServerId, "/zones", "/", zoneId)
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers","/", c.serverId, "/zones", "/", zoneId)
 
 	req, err := c.createRequest("GET", reqUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := c.client.Do(req)
+	response, body, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	if err := expectStatus("get zone "+zoneId, response, body, http.StatusOK); err != nil {
+		return nil, err
+	}
 
-	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNotFound {
-		return nil, fmt.Errorf("failed to get DNS zone: %s", response.Status)
+	zone := &PdnsZone{}
+	if c.apiVersion == ApiVersionV0 {
+		// v0 returns the zone wrapped in a single-element array instead of
+		// as a bare object.
+		zones := []PdnsZone{}
+		if err := json.Unmarshal(body, &zones); err != nil {
+			return nil, err
+		}
+		if len(zones) == 0 {
+			return nil, newAPIError("get zone "+zoneId, http.StatusNotFound, body)
+		}
+		zone = &zones[0]
+	} else if err := json.Unmarshal(body, zone); err != nil {
+		return nil, err
 	}
 
-	if response.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("domain %s does not exists in DNS zone", zoneId)
+	return zone, nil
+}
+
+// CreateZone POSTs a new zone to "/servers/{id}/zones". kind is PowerDNS's
+// zone type ("Native", "Master", or "Slave"); nameservers, if non-empty,
+// has PowerDNS create matching NS records as part of creation. The zone's
+// masters are not set.
+func (c *PowerDnsApiClient) CreateZone(name string, kind string, nameservers []string) (*PdnsZone, error) {
+	reqUrl, err := c.apiUrl()
+	if err != nil {
+		return nil, err
 	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/zones")
 
-	responseBytes, err := ioutil.ReadAll(response.Body)
+	jsonBytes, err := json.Marshal(PdnsZone{
+		Name:        name,
+		Kind:        kind,
+		Nameservers: nameservers,
+	})
 	if err != nil {
 		return nil, err
 	}
-	zones := &PdnsZone{}
-	err = json.Unmarshal(responseBytes, &zones)
+
+	req, err := c.createRequest("POST", reqUrl.String(), bytes.NewReader(jsonBytes))
 	if err != nil {
 		return nil, err
 	}
 
-	return zones, nil
-}
+	response, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectStatus("create zone "+name, response, body, http.StatusCreated); err != nil {
+		return nil, err
+	}
+
+	zone := &PdnsZone{}
+	if err := json.Unmarshal(body, zone); err != nil {
+		return nil, err
+	}
 
+	return zone, nil
+}
 
 func (c *PowerDnsApiClient) GetZoneRRSets(zoneId string) ([]PdnsRRSet, error) {
-	reqUrl, err := c.getApiUrl()
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return nil, err
 	}
-	reqUrl.Path = path.Join(reqUrl.Path, "/servers","/", DefaultServerId, "/zones", "/", zoneId)
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/zones", "/", zoneId)
+
+	req, err := c.createRequest("GET", reqUrl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectStatus("get zone rrsets "+zoneId, response, body, http.StatusOK); err != nil {
+		return nil, err
+	}
+
+	zone := PdnsZone{}
+	if err := json.Unmarshal(body, &zone); err != nil {
+		return nil, err
+	}
+
+	return zone.RRsets, nil
+}
+
+func (c *PowerDnsApiClient) UpdateZoneRRSets(zoneId string, rrSets []PdnsRRSet) error {
+	reqUrl, err := c.apiUrl()
+	if err != nil {
+		return err
+	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/zones", "/", zoneId)
 
+	updateRequest := RRSetsUpdate{
+		RRSets: rrSets,
+	}
+
+	jsonBytes, err := json.Marshal(updateRequest)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.createRequest("PATCH", reqUrl.String(), bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	return expectStatus("update rrsets "+zoneId, response, body, http.StatusNoContent)
+}
+
+// UpdateZone PUTs zone-level settings (SOA-EDIT, NSEC3PARAM, API-RECTIFY,
+// DNSSEC, account, ...) for an existing zone. It doesn't touch rrsets.
+func (c *PowerDnsApiClient) UpdateZone(zoneId string, zone PdnsZone) error {
+	reqUrl, err := c.apiUrl()
+	if err != nil {
+		return err
+	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/zones", "/", zoneId)
+
+	jsonBytes, err := json.Marshal(zone)
+	if err != nil {
+		return err
+	}
+
+	req, err := c.createRequest("PUT", reqUrl.String(), bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	return expectStatus("update zone "+zoneId, response, body, http.StatusNoContent)
+}
+
+// EnableDNSSEC provisions a new active KSK for the zone, the step PowerDNS
+// requires in addition to setting "dnssec": true on the zone object.
+func (c *PowerDnsApiClient) EnableDNSSEC(zoneId string) error {
+	reqUrl, err := c.apiUrl()
+	if err != nil {
+		return err
+	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/zones", "/", zoneId, "/cryptokeys")
+
+	jsonBytes, err := json.Marshal(PdnsCryptoKeyRequest{KeyType: "ksk", Active: true})
+	if err != nil {
+		return err
+	}
+
+	req, err := c.createRequest("POST", reqUrl.String(), bytes.NewReader(jsonBytes))
+	if err != nil {
+		return err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	return expectStatus("enable dnssec "+zoneId, response, body, http.StatusCreated)
+}
+
+// RectifyZone asks PowerDNS to recalculate DNSSEC ordering/hashing data for
+// the zone, required after NSEC3PARAM or rrset changes on a signed zone with
+// "api_rectify" not already handling it automatically.
+func (c *PowerDnsApiClient) RectifyZone(zoneId string) error {
+	reqUrl, err := c.apiUrl()
+	if err != nil {
+		return err
+	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/zones", "/", zoneId, "/rectify")
+
+	req, err := c.createRequest("PUT", reqUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return err
+	}
+
+	return expectStatus("rectify zone "+zoneId, response, body, http.StatusOK)
+}
+
+// ListTSIGKeys returns the TSIG keys registered on the server.
+func (c *PowerDnsApiClient) ListTSIGKeys() ([]PdnsTSIGKey, error) {
+	reqUrl, err := c.apiUrl()
+	if err != nil {
+		return nil, err
+	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/tsigkeys")
 
 	req, err := c.createRequest("GET", reqUrl.String(), nil)
 	if err != nil {
 		return nil, err
 	}
 
-	response, err := c.client.Do(req)
+	response, body, err := c.do(req)
 	if err != nil {
 		return nil, err
 	}
+	if err := expectStatus("list tsig keys", response, body, http.StatusOK); err != nil {
+		return nil, err
+	}
 
-	if response.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("failed to get DNS zones RRSets: %s", response.Status)
+	var keys []PdnsTSIGKey
+	if err := json.Unmarshal(body, &keys); err != nil {
+		return nil, err
 	}
 
-	responseBytes, err := ioutil.ReadAll(response.Body)
+	return keys, nil
+}
+
+// CreateTSIGKey provisions a new TSIG key via "POST /tsigkeys".
+func (c *PowerDnsApiClient) CreateTSIGKey(key PdnsTSIGKey) (*PdnsTSIGKey, error) {
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return nil, err
 	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/tsigkeys")
 
-	zone := PdnsZone{}
-	err = json.Unmarshal(responseBytes, &zone)
+	jsonBytes, err := json.Marshal(key)
 	if err != nil {
 		return nil, err
 	}
 
-	return zone.RRsets, nil
+	req, err := c.createRequest("POST", reqUrl.String(), bytes.NewReader(jsonBytes))
+	if err != nil {
+		return nil, err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := expectStatus("create tsig key "+key.Name, response, body, http.StatusCreated); err != nil {
+		return nil, err
+	}
+
+	created := &PdnsTSIGKey{}
+	if err := json.Unmarshal(body, created); err != nil {
+		return nil, err
+	}
+
+	return created, nil
 }
 
-func (c *PowerDnsApiClient) UpdateZoneRRSets(zoneId string, rrSets []PdnsRRSet) (error) {
-	reqUrl, err := c.getApiUrl()
+// UpdateTSIGKey changes the algorithm/secret of an existing TSIG key via
+// "PUT /tsigkeys/{id}".
+func (c *PowerDnsApiClient) UpdateTSIGKey(id string, key PdnsTSIGKey) error {
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return err
 	}
-	reqUrl.Path = path.Join(reqUrl.Path, "/servers","/", DefaultServerId, "/zones", "/", zoneId)
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/tsigkeys", "/", id)
 
-	updateRequest := RRSetsUpdate{
-		RRSets: rrSets,
+	jsonBytes, err := json.Marshal(key)
+	if err != nil {
+		return err
 	}
 
-	jsonBytes, err := json.Marshal(updateRequest)
+	req, err := c.createRequest("PUT", reqUrl.String(), bytes.NewReader(jsonBytes))
 	if err != nil {
 		return err
 	}
-	fmt.Println(string(jsonBytes))
 
-	reader := bytes.NewReader(jsonBytes)
-	req, err := c.createRequest("PATCH", reqUrl.String(), reader)
+	response, body, err := c.do(req)
 	if err != nil {
 		return err
 	}
 
-	response, err := c.client.Do(req)
+	return expectStatus("update tsig key "+id, response, body, http.StatusOK)
+}
+
+// DeleteTSIGKey removes a TSIG key via "DELETE /tsigkeys/{id}".
+func (c *PowerDnsApiClient) DeleteTSIGKey(id string) error {
+	reqUrl, err := c.apiUrl()
 	if err != nil {
 		return err
 	}
+	reqUrl.Path = path.Join(reqUrl.Path, "/servers", "/", c.serverId, "/tsigkeys", "/", id)
 
-	responseBytes, _ := ioutil.ReadAll(response.Body)
-	fmt.Println(string(responseBytes))
-	
-	if response.StatusCode != http.StatusNoContent {
-		return fmt.Errorf("failed to update DNS records %s", response.Status)
+	req, err := c.createRequest("DELETE", reqUrl.String(), nil)
+	if err != nil {
+		return err
+	}
+
+	response, body, err := c.do(req)
+	if err != nil {
+		return err
 	}
 
-	return nil
+	return expectStatus("delete tsig key "+id, response, body, http.StatusNoContent)
 }
@@ -0,0 +1,65 @@
+package powerdns
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestClient(baseUrl string) *PowerDnsApiClient {
+	return &PowerDnsApiClient{
+		client:  http.DefaultClient,
+		baseUrl: baseUrl,
+		apiKey:  "test",
+	}
+}
+
+func TestDetectApiVersionPicksNewest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"version":"0","url":"/api/v0"},{"version":"1","url":"/api/v1"}]`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL)
+	if got := c.detectApiVersion(); got != "v1" {
+		t.Fatalf("expected v1, got %q", got)
+	}
+}
+
+func TestDetectApiVersionFallsBackOn404(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL)
+	if got := c.detectApiVersion(); got != ApiVersionV0 {
+		t.Fatalf("expected fallback to %q, got %q", ApiVersionV0, got)
+	}
+}
+
+func TestDetectApiVersionFallsBackOnEmptyList(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[]`))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL)
+	if got := c.detectApiVersion(); got != ApiVersionV0 {
+		t.Fatalf("expected fallback to %q, got %q", ApiVersionV0, got)
+	}
+}
+
+func TestDetectApiVersionFallsBackOnNonJSON(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("not json"))
+	}))
+	defer srv.Close()
+
+	c := newTestClient(srv.URL)
+	if got := c.detectApiVersion(); got != ApiVersionV0 {
+		t.Fatalf("expected fallback to %q, got %q", ApiVersionV0, got)
+	}
+}
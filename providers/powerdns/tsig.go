@@ -0,0 +1,146 @@
+package powerdns
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/StackExchange/dnscontrol/v2/models"
+)
+
+// Metadata keys read from DomainConfig.Metadata: comma-separated lists of
+// TSIG key names, each of which must have a matching entry in the
+// provider-level tsig_keys registered via providerMetadata (see
+// newPowerDNSProvider). dnsconfig.js sets these via the
+// POWERDNS_TSIG_MASTER/POWERDNS_TSIG_SLAVE modifiers in
+// pkg/js/helpers.js, referencing keys registered with POWERDNS_TSIG.
+const (
+	metaMasterTsigKeys = "master_tsig_keys"
+	metaSlaveTsigKeys  = "slave_tsig_keys"
+)
+
+// tsigKeyConfig is a TSIG key registered at the provider level via the
+// "tsig_keys" provider metadata array (see providerMetadata), keyed by
+// Name. PowerDNS canonicalizes a key's id to its name, so Name doubles as
+// the id referenced by master_tsig_key_ids/slave_tsig_key_ids.
+type tsigKeyConfig struct {
+	Name      string `json:"name"`
+	Algorithm string `json:"algorithm"`
+	Secret    string `json:"secret"`
+}
+
+func (p *PowerDNSProvider) findTSIGKeyConfig(name string) (tsigKeyConfig, bool) {
+	for _, k := range p.tsigKeys {
+		if k.Name == name {
+			return k, true
+		}
+	}
+	return tsigKeyConfig{}, false
+}
+
+// ensureTSIGKey makes sure a TSIG key registered in the provider's tsig_keys
+// exists on the server with the configured algorithm/secret, creating or
+// updating it as needed.
+func (p *PowerDNSProvider) ensureTSIGKey(name string) error {
+	cfg, ok := p.findTSIGKeyConfig(name)
+	if !ok {
+		return fmt.Errorf("PowerDNS Provider: no tsig_keys entry registered with name %q", name)
+	}
+
+	keys, err := p.apiClient.ListTSIGKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, k := range keys {
+		if k.Name != name {
+			continue
+		}
+		if k.Algorithm == cfg.Algorithm && k.Key == cfg.Secret {
+			return nil
+		}
+		return p.apiClient.UpdateTSIGKey(k.Id, PdnsTSIGKey{Name: name, Algorithm: cfg.Algorithm, Key: cfg.Secret})
+	}
+
+	_, err = p.apiClient.CreateTSIGKey(PdnsTSIGKey{Name: name, Algorithm: cfg.Algorithm, Key: cfg.Secret})
+	return err
+}
+
+// tsigCorrection compares the master_tsig_keys/slave_tsig_keys requested for
+// dc against the zone's current master_tsig_key_ids/slave_tsig_key_ids and,
+// if they differ, returns a Correction that provisions any missing/changed
+// keys and patches the zone to reference them.
+//
+// F() re-fetches the zone before building the PUT body instead of reusing
+// the snapshot passed in here: GetDomainCorrections fetches the zone once
+// and may also run a metadata correction against that same snapshot, and
+// corrections run sequentially, so PUTting from the stale snapshot would
+// silently revert whichever correction ran first.
+func (p *PowerDNSProvider) tsigCorrection(dc *models.DomainConfig, zone *PdnsZone) (*models.Correction, error) {
+	masterNames := splitTSIGNames(dc.Metadata[metaMasterTsigKeys])
+	slaveNames := splitTSIGNames(dc.Metadata[metaSlaveTsigKeys])
+	if len(masterNames) == 0 && len(slaveNames) == 0 {
+		return nil, nil
+	}
+
+	for _, name := range append(append([]string{}, masterNames...), slaveNames...) {
+		if _, ok := p.findTSIGKeyConfig(name); !ok {
+			return nil, fmt.Errorf("PowerDNS Provider: no tsig_keys entry registered with name %q", name)
+		}
+	}
+
+	if stringsEqualUnordered(masterNames, zone.MasterTsigKeyIds) && stringsEqualUnordered(slaveNames, zone.SlaveTsigKeyIds) {
+		return nil, nil
+	}
+
+	return &models.Correction{
+		Msg: fmt.Sprintf("Update TSIG keys for %s: master=%v slave=%v", dc.Name, masterNames, slaveNames),
+		F: func() error {
+			for _, name := range append(append([]string{}, masterNames...), slaveNames...) {
+				if err := p.ensureTSIGKey(name); err != nil {
+					return err
+				}
+			}
+
+			current, err := p.apiClient.GetZone(dc.Name)
+			if err != nil {
+				return err
+			}
+			update := *current
+			update.RRsets = nil
+			update.MasterTsigKeyIds = masterNames
+			update.SlaveTsigKeyIds = slaveNames
+
+			return p.apiClient.UpdateZone(dc.Name, update)
+		},
+	}, nil
+}
+
+func splitTSIGNames(s string) []string {
+	if s == "" {
+		return nil
+	}
+	var names []string
+	for _, part := range strings.Split(s, ",") {
+		if name := strings.TrimSpace(part); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func stringsEqualUnordered(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	ac := append([]string{}, a...)
+	bc := append([]string{}, b...)
+	sort.Strings(ac)
+	sort.Strings(bc)
+	for i := range ac {
+		if ac[i] != bc[i] {
+			return false
+		}
+	}
+	return true
+}